@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// runSnapshotCLI implements `launcher snapshot <id> [flags]`, a thin HTTP
+// client against a running daemon's control plane.
+func runSnapshotCLI(args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	addr := fs.String("addr", "http://localhost:8080", "address of the running daemon")
+	dir := fs.String("dir", "", "directory to write mem_file and snapshot_file to")
+	exit := fs.Bool("exit", false, "stop the VM after snapshotting instead of resuming it")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: launcher snapshot <id> -dir=<dir> [-exit] [-addr=<addr>]")
+		os.Exit(2)
+	}
+	id := fs.Arg(0)
+
+	body, _ := json.Marshal(snapshotRequest{Dir: *dir, Exit: *exit})
+	resp, err := http.Post(fmt.Sprintf("%s/vms/%s/snapshot", *addr, id), "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "snapshot request failed: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	printCLIResponse(resp)
+}
+
+// runRestoreCLI implements `launcher restore [flags]`, a thin HTTP client
+// against a running daemon's control plane.
+func runRestoreCLI(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	addr := fs.String("addr", "http://localhost:8080", "address of the running daemon")
+	dir := fs.String("dir", "", "directory containing mem_file and snapshot_file from a prior snapshot")
+	fs.Parse(args)
+
+	body, _ := json.Marshal(restoreRequest{Dir: *dir})
+	resp, err := http.Post(fmt.Sprintf("%s/vms/restore", *addr), "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore request failed: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	printCLIResponse(resp)
+}
+
+// printCLIResponse pretty-prints a daemon JSON response, or the raw error
+// body if the daemon returned a non-2xx status.
+func printCLIResponse(resp *http.Response) {
+	body, _ := io.ReadAll(resp.Body)
+
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, body, "", "  ") == nil {
+		fmt.Println(pretty.String())
+	} else {
+		fmt.Println(string(body))
+	}
+
+	if resp.StatusCode >= 300 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// writeCloudInitISO renders a minimal user-data/meta-data pair and packs
+// them into a "cidata" ISO9660 volume, so guests can pick up their network
+// configuration without a prebaked image. genisoimage is what the usual
+// cloud-init NoCloud docs use, so we shell out to it rather than linking an
+// ISO library in.
+func writeCloudInitISO(dir string, vmID string, alloc *allocation) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	userData := fmt.Sprintf(`#cloud-config
+hostname: %s
+network:
+  version: 2
+  ethernets:
+    eth0:
+      addresses: [%s/30]
+      gateway4: %s
+`, vmID, alloc.GuestIP.String(), alloc.HostIP.String())
+
+	metaData := fmt.Sprintf("instance-id: %s\nlocal-hostname: %s\n", vmID, vmID)
+
+	userDataPath := filepath.Join(dir, "user-data")
+	metaDataPath := filepath.Join(dir, "meta-data")
+
+	if err := os.WriteFile(userDataPath, []byte(userData), 0644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(metaDataPath, []byte(metaData), 0644); err != nil {
+		return "", err
+	}
+
+	isoPath := filepath.Join(dir, "cloud-init.iso")
+	cmd := exec.Command("genisoimage", "-output", isoPath, "-volid", "cidata", "-joliet", "-rock", userDataPath, metaDataPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("genisoimage: %w: %s", err, out)
+	}
+
+	return isoPath, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const controlSocketPath = "/run/init.sock"
+
+// serveControlSocket listens on a UNIX socket and lets a busybox shell
+// operator poke the supervisor with simple line commands:
+//
+//	status
+//	restart <name>
+//	stop <name>
+func serveControlSocket(s *supervisor) {
+	os.Remove(controlSocketPath)
+
+	listener, err := net.Listen("unix", controlSocketPath)
+	if err != nil {
+		fmt.Printf("control socket: %v\n", err)
+		return
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			continue
+		}
+		go handleControlConn(s, conn)
+	}
+}
+
+func handleControlConn(s *supervisor, conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "status":
+			for _, line := range s.Status() {
+				fmt.Fprintln(conn, line)
+			}
+
+		case "restart":
+			if len(fields) != 2 {
+				fmt.Fprintln(conn, "usage: restart <name>")
+				continue
+			}
+			if err := s.Restart(fields[1]); err != nil {
+				fmt.Fprintf(conn, "error: %v\n", err)
+			}
+
+		case "stop":
+			if len(fields) != 2 {
+				fmt.Fprintln(conn, "usage: stop <name>")
+				continue
+			}
+			if err := s.Stop(fields[1]); err != nil {
+				fmt.Fprintf(conn, "error: %v\n", err)
+			}
+
+		default:
+			fmt.Fprintf(conn, "unknown command %q\n", fields[0])
+		}
+	}
+}
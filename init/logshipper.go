@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// vsockHostCID is the well-known context ID that identifies the host from
+// inside a guest, per AF_VSOCK conventions.
+const vsockHostCID = 2
+
+// defaultVsockLogPort is the vsock port the log collector listens on
+// unless overridden by a "vsock_log_port=" kernel argument.
+const defaultVsockLogPort = 10000
+
+// logFrameHeader is the small JSON header prefixed to every log record
+// shipped over vsock, letting the host demultiplex interleaved unit output
+// back into per-unit files.
+type logFrameHeader struct {
+	Unit   string `json:"unit"`
+	Stream string `json:"stream"`
+	TS     int64  `json:"ts"`
+}
+
+// vsockShipper streams framed log records to a host-side collector over
+// AF_VSOCK. It reconnects with backoff if the host collector isn't
+// listening yet when init boots, or if the connection drops.
+type vsockShipper struct {
+	port uint32
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// newVsockShipper starts connecting to the host collector in the
+// background and returns immediately; Write is a no-op until the
+// connection succeeds.
+func newVsockShipper(port uint32) *vsockShipper {
+	s := &vsockShipper{port: port}
+	go s.connectLoop()
+	return s
+}
+
+func (s *vsockShipper) connectLoop() {
+	backoff := time.Second
+	const maxBackoff = 30 * time.Second
+
+	for {
+		s.mu.Lock()
+		connected := s.conn != nil
+		s.mu.Unlock()
+
+		if connected {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		conn, err := dialVsock(vsockHostCID, s.port)
+		if err != nil {
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		s.conn = conn
+		s.mu.Unlock()
+		backoff = time.Second
+	}
+}
+
+// Write ships one framed record for unit/stream. It's best-effort: if
+// there's no live connection the record is dropped rather than blocking
+// the service's own stdout/stderr pipe.
+func (s *vsockShipper) Write(unit string, stream string, data []byte) {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn == nil {
+		return
+	}
+
+	header, err := json.Marshal(logFrameHeader{Unit: unit, Stream: stream, TS: time.Now().Unix()})
+	if err != nil {
+		return
+	}
+
+	if err := writeFrame(conn, header, data); err != nil {
+		s.mu.Lock()
+		if s.conn == conn {
+			conn.Close()
+			s.conn = nil
+		}
+		s.mu.Unlock()
+	}
+}
+
+// writeFrame writes one length-prefixed header followed by one
+// length-prefixed payload.
+func writeFrame(w net.Conn, header []byte, data []byte) error {
+	var lenBuf [4]byte
+
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(header)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// dialVsock opens an AF_VSOCK connection to the given CID/port.
+func dialVsock(cid uint32, port uint32) (net.Conn, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unix.Connect(fd, &unix.SockaddrVM{CID: cid, Port: port}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	file := os.NewFile(uintptr(fd), fmt.Sprintf("vsock:%d:%d", cid, port))
+	defer file.Close()
+	return net.FileConn(file)
+}
+
+// shippingWriter tees a unit's output to its local log file and to the
+// vsock shipper, tagged with the unit name and stream.
+type shippingWriter struct {
+	file    *os.File
+	shipper *vsockShipper
+	unit    string
+	stream  string
+}
+
+func (w shippingWriter) Write(p []byte) (int, error) {
+	w.shipper.Write(w.unit, w.stream, p)
+	return w.file.Write(p)
+}
+
+// vsockLogPortFromCmdline reads a "vsock_log_port=<n>" argument out of
+// /proc/cmdline, falling back to defaultVsockLogPort if it's absent or
+// unparsable.
+func vsockLogPortFromCmdline() uint32 {
+	f, err := os.Open("/proc/cmdline")
+	if err != nil {
+		return defaultVsockLogPort
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		arg := scanner.Text()
+		if !strings.HasPrefix(arg, "vsock_log_port=") {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimPrefix(arg, "vsock_log_port="), 10, 32)
+		if err != nil {
+			break
+		}
+		return uint32(n)
+	}
+	return defaultVsockLogPort
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// TestWriteFrame exercises the guest side of the framing logcollector.go
+// parses on the host: a 4-byte big-endian length + header, followed by a
+// 4-byte length + payload.
+func TestWriteFrame(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	header := []byte(`{"unit":"web","stream":"stdout","ts":1234}`)
+	payload := []byte("hello from the guest\n")
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- writeFrame(client, header, payload) }()
+
+	gotHeader := readLenPrefixed(t, server)
+	if !bytes.Equal(gotHeader, header) {
+		t.Fatalf("got header %q, want %q", gotHeader, header)
+	}
+
+	gotPayload := readLenPrefixed(t, server)
+	if !bytes.Equal(gotPayload, payload) {
+		t.Fatalf("got payload %q, want %q", gotPayload, payload)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("writeFrame: %v", err)
+	}
+}
+
+func readLenPrefixed(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		t.Fatalf("read length prefix: %v", err)
+	}
+	buf := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("read frame body: %v", err)
+	}
+	return buf
+}
@@ -6,14 +6,15 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"syscall"
-	"time"
+	"strings"
+
+	"golang.org/x/sys/unix"
 )
 
 func main() {
 	// Handle signals
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(signals, unix.SIGTERM, unix.SIGINT)
 
 	// Mount necessary filesystems
 	// This isnt strictly necessary, but it's good practice to do it.
@@ -25,13 +26,16 @@ func main() {
 	mount("/tmp", "tmpfs")
 	mount("/run", "tmpfs")
 
-	// Start reaping zombies
-	go reapZombies()
-
-	// Start the services
-	if err := startServices("/etc/services", "/var/log"); err != nil {
-		fmt.Printf("Failed to start processes: %v\n", err)
+	// Start the service supervisor: it reaps zombies itself, so there's no
+	// separate reapZombies goroutine anymore. Service output is shipped to
+	// the host over vsock in addition to the local /var/log files.
+	shipper := newVsockShipper(vsockLogPortFromCmdline())
+	sv := newSupervisor("/var/log", shipper)
+	if err := sv.Load("/etc/services"); err != nil {
+		fmt.Printf("Failed to load services: %v\n", err)
 	}
+	sv.Run()
+	go serveControlSocket(sv)
 
 	// Start a shell for us to interact with
 	cmd := exec.Command("/bin/busybox", "sh")
@@ -45,86 +49,34 @@ func main() {
 
 	// Handle shutdown gracefully
 	<-signals
-	syscall.Reboot(syscall.LINUX_REBOOT_CMD_RESTART)
-}
-
-// reapZombies continuously waits for exited child processes (zombies) and reaps them.
-// This prevents the accumulation of zombie processes, which can occur if the parent
-// does not collect the exit status of its children. The inner loop calls Wait4 with
-// WNOHANG to avoid blocking, and it reaps all available zombies in one pass.
-// The outer loop runs indefinitely with a short sleep to avoid high CPU usage when no children exit.
-func reapZombies() {
-	for {
-		var ws syscall.WaitStatus
-		for {
-			pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
-			if pid <= 0 || err != nil {
-				break
-			}
-		}
-		time.Sleep(time.Second)
-	}
+	unix.Reboot(unix.LINUX_REBOOT_CMD_RESTART)
 }
 
-// mount mounts a filesystem on a target path.
+// mount mounts a filesystem on a target path. It's a no-op if target is
+// already a mountpoint, so a restored snapshot's init doesn't try to
+// double-mount /proc and friends.
 func mount(target string, fstype string) {
 	os.MkdirAll(target, 0755)
-	syscall.Mount("none", target, fstype, 0, "")
+	if isMountpoint(target) {
+		return
+	}
+	unix.Mount("none", target, fstype, 0, "")
 }
 
-// startServices starts all the services in the given directory.
-// It reads all the files in the directory and starts them if they are executable.
-// It also logs the output of the services to the given log directory.
-func startServices(binaryDir string, logDir string) error {
-	files, err := os.ReadDir(binaryDir)
+// isMountpoint checks /proc/self/mountinfo for an existing mount at target.
+func isMountpoint(target string) bool {
+	data, err := os.ReadFile("/proc/self/mountinfo")
 	if err != nil {
-		return err
+		return false
 	}
 
-	// Iterate over all the files in the directory
-	for _, file := range files {
-		// Skip directories
-		if file.IsDir() {
-			continue
-		}
-
-		// Get the full path of the file
-		filePath := filepath.Join(binaryDir, file.Name())
-		info, err := os.Stat(filePath)
-		if err != nil {
-			continue
-		}
-
-		// If the file is executable, start it and log its output
-		if info.Mode().Perm()&0111 != 0 {
-			go startAndLogProcess(filePath, filepath.Join(logDir, fmt.Sprintf("%s.log", file.Name())))
+	want := filepath.Clean(target)
+	for _, line := range strings.Split(string(data), "\n") {
+		// mountinfo fields: mount_id parent_id major:minor root mount_point ...
+		fields := strings.Fields(line)
+		if len(fields) > 4 && fields[4] == want {
+			return true
 		}
 	}
-
-	return nil
-}
-
-// startAndLogProcess starts a process and logs its output to a file.
-func startAndLogProcess(binaryPath string, logFilePath string) {
-	// Open the log file for writing. If it doesn't exist, create it.
-	logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil || logFile == nil {
-		return
-	}
-	defer logFile.Close()
-
-	// Create a new command to run the binary
-	cmd := exec.Command(binaryPath)
-
-	// Set the output of the command to the log file
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
-
-	// Start the process
-	if err := cmd.Start(); err != nil {
-		return
-	}
-
-	// Wait for the process to finish
-	cmd.Wait()
+	return false
 }
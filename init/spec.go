@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceSpec is the declarative description of a single unit, loaded from
+// an "*.service" file under /etc/services. It replaces the original
+// tutorial's "any executable file in /etc/services gets started" behavior
+// with something that can express restart policy, backoff, and ordering —
+// while still falling back to the old bare-executable behavior for files
+// that aren't a spec, so existing rootfs images keep working.
+type serviceSpec struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+
+	Args []string `json:"args,omitempty"`
+	Env  []string `json:"env,omitempty"`
+	Cwd  string   `json:"cwd,omitempty"`
+	User string   `json:"user,omitempty"`
+
+	// Restart is one of "always" (default), "on-failure", or "never".
+	Restart string `json:"restart,omitempty"`
+	// Backoff is the initial delay before restarting a crashed unit,
+	// doubling on each consecutive failure up to MaxBackoff.
+	Backoff string `json:"backoff,omitempty"`
+	// MaxBackoff caps the exponential backoff delay.
+	MaxBackoff string `json:"max_backoff,omitempty"`
+	// DependsOn lists unit names that must be started (not necessarily
+	// healthy) before this one is.
+	DependsOn []string `json:"depends_on,omitempty"`
+	// LogMaxBytes rotates the unit's log file, keeping a single ".1"
+	// backup, when the unit is (re)started and the file has reached this
+	// size; a file is not rotated while the unit is running. Zero disables
+	// rotation.
+	LogMaxBytes int64 `json:"log_max_bytes,omitempty"`
+
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+const (
+	restartAlways    = "always"
+	restartOnFailure = "on-failure"
+	restartNever     = "never"
+)
+
+// loadServiceSpecs reads every file in dir and turns it into a serviceSpec:
+// "*.service" files are parsed, and any other executable file is
+// treated as a bare, restart-always service the way the original tutorial
+// init worked.
+func loadServiceSpecs(dir string) ([]serviceSpec, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []serviceSpec
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		filePath := filepath.Join(dir, file.Name())
+
+		if strings.HasSuffix(file.Name(), ".service") {
+			spec, err := loadServiceSpec(filePath)
+			if err != nil {
+				fmt.Printf("Failed to load service spec %s: %v\n", filePath, err)
+				continue
+			}
+			specs = append(specs, applyDefaults(spec))
+			continue
+		}
+
+		info, err := os.Stat(filePath)
+		if err != nil || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		specs = append(specs, applyDefaults(serviceSpec{Name: file.Name(), Path: filePath}))
+	}
+
+	return specs, nil
+}
+
+func loadServiceSpec(specPath string) (serviceSpec, error) {
+	b, err := os.ReadFile(specPath)
+	if err != nil {
+		return serviceSpec{}, err
+	}
+
+	var spec serviceSpec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return serviceSpec{}, err
+	}
+	return spec, nil
+}
+
+// applyDefaults fills in restart policy and backoff fields left zero by the
+// spec file.
+func applyDefaults(spec serviceSpec) serviceSpec {
+	if spec.Restart == "" {
+		spec.Restart = restartAlways
+	}
+
+	spec.backoff = time.Second
+	if spec.Backoff != "" {
+		if d, err := time.ParseDuration(spec.Backoff); err == nil {
+			spec.backoff = d
+		}
+	}
+
+	spec.maxBackoff = 30 * time.Second
+	if spec.MaxBackoff != "" {
+		if d, err := time.ParseDuration(spec.MaxBackoff); err == nil {
+			spec.maxBackoff = d
+		}
+	}
+
+	return spec
+}
+
+// shouldRestart decides whether a unit should be relaunched after exiting
+// with the given success flag, according to its restart policy.
+func shouldRestart(policy string, exitedCleanly bool) bool {
+	switch policy {
+	case restartNever:
+		return false
+	case restartOnFailure:
+		return !exitedCleanly
+	default:
+		return true
+	}
+}
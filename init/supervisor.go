@@ -0,0 +1,448 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// unit is the runtime state the supervisor keeps for a single serviceSpec:
+// its current pid, lifecycle state, and the machinery needed to let other
+// goroutines (the reaper, the control socket) observe and act on it.
+type unit struct {
+	spec serviceSpec
+
+	mu       sync.Mutex
+	pid      int
+	state    string // "waiting", "running", "stopped", "crashed"
+	restarts int
+	stopped  bool // explicitly stopped via the control socket; excluded from auto-restart
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	nudge     chan struct{}
+}
+
+func newUnit(spec serviceSpec) *unit {
+	return &unit{
+		spec:  spec,
+		state: "waiting",
+		ready: make(chan struct{}),
+		nudge: make(chan struct{}, 1),
+	}
+}
+
+func (u *unit) markReady() {
+	u.readyOnce.Do(func() { close(u.ready) })
+}
+
+// supervisor owns every unit's lifecycle: starting them in dependency
+// order, restarting crashed units per their policy, and correlating
+// reaped child exits back to the unit that owned the pid.
+type supervisor struct {
+	logDir  string
+	shipper *vsockShipper
+
+	mu       sync.Mutex
+	units    map[string]*unit
+	pidOwner map[int]chan unix.WaitStatus
+}
+
+func newSupervisor(logDir string, shipper *vsockShipper) *supervisor {
+	return &supervisor{
+		logDir:   logDir,
+		shipper:  shipper,
+		units:    make(map[string]*unit),
+		pidOwner: make(map[int]chan unix.WaitStatus),
+	}
+}
+
+// Load reads every service spec under serviceDir and registers a unit for
+// each of them.
+func (s *supervisor) Load(serviceDir string) error {
+	specs, err := loadServiceSpecs(serviceDir)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, spec := range specs {
+		s.units[spec.Name] = newUnit(spec)
+	}
+	return nil
+}
+
+// Run starts a management goroutine per unit and the shared zombie reaper.
+// It returns immediately; units start asynchronously as their dependencies
+// become ready.
+func (s *supervisor) Run() {
+	go s.reapLoop()
+
+	s.mu.Lock()
+	units := make([]*unit, 0, len(s.units))
+	for _, u := range s.units {
+		units = append(units, u)
+	}
+	s.mu.Unlock()
+
+	for _, u := range units {
+		go s.manage(u)
+	}
+}
+
+// manage runs the full lifecycle of a single unit: wait for dependencies,
+// then loop (start, wait for exit, maybe restart with backoff) until the
+// unit is stopped or its restart policy says to give up.
+func (s *supervisor) manage(u *unit) {
+	s.awaitDependencies(u)
+
+	backoff := u.spec.backoff
+	for {
+		u.mu.Lock()
+		stopped := u.stopped
+		u.mu.Unlock()
+		if stopped {
+			<-u.nudge
+			continue
+		}
+
+		ws, err := s.startOnce(u)
+		if err != nil {
+			fmt.Printf("unit %s: failed to start: %v\n", u.spec.Name, err)
+			u.setState("crashed")
+			time.Sleep(backoff)
+			backoff = nextBackoff(backoff, u.spec.maxBackoff)
+			continue
+		}
+
+		u.mu.Lock()
+		stopped = u.stopped
+		u.restarts++
+		u.mu.Unlock()
+
+		if stopped {
+			u.setState("stopped")
+			continue
+		}
+
+		exitedCleanly := ws.Exited() && ws.ExitStatus() == 0
+		u.setState(exitStateLabel(exitedCleanly))
+
+		if !shouldRestart(u.spec.Restart, exitedCleanly) {
+			u.mu.Lock()
+			u.stopped = true
+			u.mu.Unlock()
+			continue
+		}
+
+		// A clean exit ends a run of failures, so the delay only keeps
+		// doubling across consecutive crashes.
+		if exitedCleanly {
+			backoff = u.spec.backoff
+		}
+		time.Sleep(backoff)
+		if !exitedCleanly {
+			backoff = nextBackoff(backoff, u.spec.maxBackoff)
+		}
+	}
+}
+
+func exitStateLabel(exitedCleanly bool) string {
+	if exitedCleanly {
+		return "stopped"
+	}
+	return "crashed"
+}
+
+func nextBackoff(current, max time.Duration) time.Duration {
+	next := current * 2
+	if next > max {
+		return max
+	}
+	return next
+}
+
+// awaitDependencies blocks until every unit this one depends on has started
+// at least once, or logs a warning and proceeds after a timeout so a
+// missing/cyclic dependency can't hang boot forever.
+func (s *supervisor) awaitDependencies(u *unit) {
+	for _, depName := range u.spec.DependsOn {
+		s.mu.Lock()
+		dep, ok := s.units[depName]
+		s.mu.Unlock()
+		if !ok {
+			fmt.Printf("unit %s: unknown dependency %q, starting anyway\n", u.spec.Name, depName)
+			continue
+		}
+
+		select {
+		case <-dep.ready:
+		case <-time.After(30 * time.Second):
+			fmt.Printf("unit %s: timed out waiting for dependency %q, starting anyway\n", u.spec.Name, depName)
+		}
+	}
+}
+
+// startOnce execs the unit's process, registers its pid with the reaper,
+// and blocks until that pid exits.
+func (s *supervisor) startOnce(u *unit) (unix.WaitStatus, error) {
+	logPath := filepath.Join(s.logDir, fmt.Sprintf("%s.log", u.spec.Name))
+	if u.spec.LogMaxBytes > 0 {
+		rotateLogIfNeeded(logPath, u.spec.LogMaxBytes)
+	}
+
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return unix.WaitStatus(0), err
+	}
+	defer logFile.Close()
+
+	env := os.Environ()
+	if len(u.spec.Env) > 0 {
+		env = append(env, u.spec.Env...)
+	}
+
+	// exec.Command resolves a bare Path via LookPath against the init
+	// process's own PATH at construction time, before cmd.Env is ever set -
+	// resolve it ourselves against the unit's merged PATH so a spec whose
+	// Env overrides PATH (as rootfsbuilder's image-derived specs often do)
+	// actually gets honored.
+	resolvedPath, err := resolveExecPath(u.spec.Path, env)
+	if err != nil {
+		return unix.WaitStatus(0), err
+	}
+
+	cmd := &exec.Cmd{
+		Path: resolvedPath,
+		Args: append([]string{u.spec.Path}, u.spec.Args...),
+	}
+	if s.shipper != nil {
+		cmd.Stdout = shippingWriter{file: logFile, shipper: s.shipper, unit: u.spec.Name, stream: "stdout"}
+		cmd.Stderr = shippingWriter{file: logFile, shipper: s.shipper, unit: u.spec.Name, stream: "stderr"}
+	} else {
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+	}
+	if len(u.spec.Env) > 0 {
+		cmd.Env = env
+	}
+	if u.spec.Cwd != "" {
+		cmd.Dir = u.spec.Cwd
+	}
+	if u.spec.User != "" {
+		if err := setCmdUser(cmd, u.spec.User); err != nil {
+			return unix.WaitStatus(0), fmt.Errorf("set user %q: %w", u.spec.User, err)
+		}
+	}
+
+	// Hold s.mu across Start and pid registration, and have reapLoop take
+	// the same lock around its Wait4 call: otherwise a child that crashes
+	// immediately can be reaped before pidOwner[pid] is set, dropping its
+	// exit status, and a recycled pid could later be misdelivered to this
+	// unit's exitCh.
+	s.mu.Lock()
+	if err := cmd.Start(); err != nil {
+		s.mu.Unlock()
+		return unix.WaitStatus(0), err
+	}
+
+	exitCh := make(chan unix.WaitStatus, 1)
+	pid := cmd.Process.Pid
+	s.pidOwner[pid] = exitCh
+	s.mu.Unlock()
+
+	u.mu.Lock()
+	u.pid = pid
+	u.mu.Unlock()
+	u.setState("running")
+	u.markReady()
+
+	ws := <-exitCh
+
+	u.mu.Lock()
+	u.pid = 0
+	u.mu.Unlock()
+
+	return ws, nil
+}
+
+// reapLoop is the supervisor's single Wait4 caller: it reaps every exited
+// child and, if the pid belonged to a unit we're tracking, delivers the
+// wait status to that unit's manage goroutine instead of discarding it.
+func (s *supervisor) reapLoop() {
+	for {
+		for {
+			s.mu.Lock()
+			var ws unix.WaitStatus
+			pid, err := unix.Wait4(-1, &ws, unix.WNOHANG, nil)
+			if pid <= 0 || err != nil {
+				s.mu.Unlock()
+				break
+			}
+
+			ch, ok := s.pidOwner[pid]
+			delete(s.pidOwner, pid)
+			s.mu.Unlock()
+
+			if ok {
+				ch <- ws
+			}
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Stop marks a unit as explicitly stopped and signals its process to exit;
+// it will not be auto-restarted until Restart is called.
+func (s *supervisor) Stop(name string) error {
+	u, ok := s.unit(name)
+	if !ok {
+		return fmt.Errorf("unknown unit %q", name)
+	}
+
+	u.mu.Lock()
+	u.stopped = true
+	pid := u.pid
+	u.mu.Unlock()
+
+	if pid > 0 {
+		unix.Kill(pid, unix.SIGTERM)
+	}
+	return nil
+}
+
+// Restart clears a unit's stopped flag and, if it wasn't running, nudges
+// its manage goroutine to start it back up; if it was running, killing it
+// lets the normal exit/restart path in manage bring it back.
+func (s *supervisor) Restart(name string) error {
+	u, ok := s.unit(name)
+	if !ok {
+		return fmt.Errorf("unknown unit %q", name)
+	}
+
+	u.mu.Lock()
+	wasStopped := u.stopped
+	u.stopped = false
+	pid := u.pid
+	u.mu.Unlock()
+
+	if pid > 0 {
+		unix.Kill(pid, unix.SIGTERM)
+		return nil
+	}
+	if wasStopped {
+		select {
+		case u.nudge <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Status returns a human-readable status line per unit, for the control
+// socket's "status" command.
+func (s *supervisor) Status() []string {
+	s.mu.Lock()
+	units := make([]*unit, 0, len(s.units))
+	for _, u := range s.units {
+		units = append(units, u)
+	}
+	s.mu.Unlock()
+
+	lines := make([]string, 0, len(units))
+	for _, u := range units {
+		u.mu.Lock()
+		lines = append(lines, fmt.Sprintf("%s\t%s\tpid=%d\trestarts=%d", u.spec.Name, u.state, u.pid, u.restarts))
+		u.mu.Unlock()
+	}
+	return lines
+}
+
+func (s *supervisor) unit(name string) (*unit, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.units[name]
+	return u, ok
+}
+
+func (u *unit) setState(state string) {
+	u.mu.Lock()
+	u.state = state
+	u.mu.Unlock()
+}
+
+// rotateLogIfNeeded renames path to path+".1" if it has grown past
+// maxBytes, so the next open starts a fresh file.
+func rotateLogIfNeeded(path string, maxBytes int64) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() < maxBytes {
+		return
+	}
+	os.Rename(path, path+".1")
+}
+
+// resolveExecPath resolves name to an absolute path the way exec.LookPath
+// would, except it searches the PATH found in env (falling back to the
+// init process's own PATH if env doesn't set one) instead of always using
+// the init process's PATH - so a unit's own Env can affect where its bare
+// entrypoint is found. A name that already contains a slash is returned
+// unchanged, matching exec.LookPath's behavior.
+func resolveExecPath(name string, env []string) (string, error) {
+	if strings.ContainsRune(name, '/') {
+		return name, nil
+	}
+
+	pathEnv := os.Getenv("PATH")
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") {
+			pathEnv = strings.TrimPrefix(kv, "PATH=")
+		}
+	}
+
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			dir = "."
+		}
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: executable file not found in $PATH", name)
+}
+
+// setCmdUser resolves a username or uid and configures cmd to run as that
+// user, the way the image's Config.User would be honored by a container
+// runtime.
+func setCmdUser(cmd *exec.Cmd, username string) error {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return err
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	return nil
+}
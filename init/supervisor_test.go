@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShouldRestart(t *testing.T) {
+	cases := []struct {
+		policy        string
+		exitedCleanly bool
+		want          bool
+	}{
+		{restartAlways, true, true},
+		{restartAlways, false, true},
+		{restartOnFailure, true, false},
+		{restartOnFailure, false, true},
+		{restartNever, true, false},
+		{restartNever, false, false},
+		{"", true, true}, // unset policy behaves like restartAlways
+	}
+
+	for _, c := range cases {
+		got := shouldRestart(c.policy, c.exitedCleanly)
+		if got != c.want {
+			t.Errorf("shouldRestart(%q, %v) = %v, want %v", c.policy, c.exitedCleanly, got, c.want)
+		}
+	}
+}
+
+func TestResolveExecPath(t *testing.T) {
+	dir := t.TempDir()
+	binPath := filepath.Join(dir, "myapp")
+	if err := os.WriteFile(binPath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("bare name resolved against spec's own PATH", func(t *testing.T) {
+		got, err := resolveExecPath("myapp", []string{"PATH=" + dir})
+		if err != nil {
+			t.Fatalf("resolveExecPath: %v", err)
+		}
+		if got != binPath {
+			t.Errorf("resolveExecPath() = %q, want %q", got, binPath)
+		}
+	})
+
+	t.Run("absolute path returned unchanged", func(t *testing.T) {
+		got, err := resolveExecPath("/usr/bin/env", []string{"PATH=" + dir})
+		if err != nil {
+			t.Fatalf("resolveExecPath: %v", err)
+		}
+		if got != "/usr/bin/env" {
+			t.Errorf("resolveExecPath() = %q, want unchanged", got)
+		}
+	})
+
+	t.Run("not found anywhere on PATH", func(t *testing.T) {
+		if _, err := resolveExecPath("no-such-binary", []string{"PATH=" + dir}); err == nil {
+			t.Error("resolveExecPath() = nil error, want not-found error")
+		}
+	})
+}
+
+func TestNextBackoff(t *testing.T) {
+	max := 30 * time.Second
+
+	if got := nextBackoff(time.Second, max); got != 2*time.Second {
+		t.Errorf("nextBackoff(1s) = %v, want 2s", got)
+	}
+
+	if got := nextBackoff(20*time.Second, max); got != max {
+		t.Errorf("nextBackoff(20s) = %v, want capped at %v", got, max)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// defaultVsockLogPort is the vsock port the guest's log shipper connects
+// to; it must match init/logshipper.go's default (or its
+// "vsock_log_port=" kernel argument override).
+const defaultVsockLogPort = 10000
+
+// logFrameHeader mirrors init/logshipper.go's frame header: a small JSON
+// preamble in front of each record's payload that lets us demultiplex
+// interleaved unit output back into per-unit files.
+type logFrameHeader struct {
+	Unit   string `json:"unit"`
+	Stream string `json:"stream"`
+	TS     int64  `json:"ts"`
+}
+
+// startLogCollector listens on the host-side UDS that corresponds to a
+// VsockDevice's configured path and port, and demultiplexes every
+// connection it accepts into per-unit files under logDir plus an
+// aggregate stream written to the daemon's own stdout. The returned
+// io.Closer stops the accept loop and must be closed when the owning VM is
+// torn down, or the listener and its goroutine leak for the life of the
+// daemon.
+func startLogCollector(vsockUDSPath string, port uint32, logDir string) (io.Closer, error) {
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, err
+	}
+
+	// Firecracker proxies a guest's vsock connection on a given port to
+	// "<configured-uds-path>_<port>" on the host.
+	socketPath := fmt.Sprintf("%s_%d", vsockUDSPath, port)
+	os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", socketPath, err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go demuxLogConn(conn, logDir)
+		}
+	}()
+
+	return listener, nil
+}
+
+// unitNameRE is the allow-list a frame's Unit field must match before we'll
+// use it in a path: the vsock connection is reachable by any process inside
+// the guest, not just init's log shipper, so an untrusted unit name must
+// never reach the filesystem unsanitized (e.g. "../../etc/cron.d/evil").
+var unitNameRE = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// demuxLogConn reads framed records off conn until it closes, writing each
+// one to its unit's log file and echoing it to stdout tagged with unit and
+// stream.
+func demuxLogConn(conn net.Conn, logDir string) {
+	defer conn.Close()
+
+	files := make(map[string]*os.File)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for {
+		header, data, err := readLogFrame(conn)
+		if err != nil {
+			return
+		}
+
+		if filepath.Base(header.Unit) != header.Unit || !unitNameRE.MatchString(header.Unit) {
+			fmt.Printf("log collector: rejecting frame with invalid unit name %q\n", header.Unit)
+			continue
+		}
+
+		f, ok := files[header.Unit]
+		if !ok {
+			f, err = os.OpenFile(filepath.Join(logDir, header.Unit+".log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				continue
+			}
+			files[header.Unit] = f
+		}
+		f.Write(data)
+
+		fmt.Printf("[%s/%s] %s", header.Unit, header.Stream, data)
+	}
+}
+
+// readLogFrame reads one length-prefixed header followed by one
+// length-prefixed payload off r.
+func readLogFrame(r io.Reader) (logFrameHeader, []byte, error) {
+	var lenBuf [4]byte
+
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return logFrameHeader{}, nil, err
+	}
+	headerBuf := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(r, headerBuf); err != nil {
+		return logFrameHeader{}, nil, err
+	}
+
+	var header logFrameHeader
+	if err := json.Unmarshal(headerBuf, &header); err != nil {
+		return logFrameHeader{}, nil, err
+	}
+
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return logFrameHeader{}, nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return logFrameHeader{}, nil, err
+	}
+
+	return header, data, nil
+}
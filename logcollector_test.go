@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+// TestReadLogFrame exercises the host side of the framing init/logshipper.go
+// writes: a 4-byte big-endian length + JSON header, followed by a 4-byte
+// length + payload.
+func TestReadLogFrame(t *testing.T) {
+	header, err := json.Marshal(logFrameHeader{Unit: "web", Stream: "stdout", TS: 1234})
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	payload := []byte("hello from the guest\n")
+
+	var buf bytes.Buffer
+	writeLenPrefixed(&buf, header)
+	writeLenPrefixed(&buf, payload)
+
+	gotHeader, gotData, err := readLogFrame(&buf)
+	if err != nil {
+		t.Fatalf("readLogFrame: %v", err)
+	}
+	if gotHeader.Unit != "web" || gotHeader.Stream != "stdout" || gotHeader.TS != 1234 {
+		t.Fatalf("got header %+v, want {Unit:web Stream:stdout TS:1234}", gotHeader)
+	}
+	if !bytes.Equal(gotData, payload) {
+		t.Fatalf("got data %q, want %q", gotData, payload)
+	}
+}
+
+func writeLenPrefixed(buf *bytes.Buffer, b []byte) {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(b)))
+	buf.Write(lenBuf[:])
+	buf.Write(b)
+}
@@ -2,41 +2,198 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
-	"github.com/firecracker-microvm/firecracker-go-sdk"
-	"github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	"github.com/Code42Cate/firecracker-init-tutorial/rootfsbuilder"
 )
 
 func main() {
-	ctx := context.TODO()
-
-	machine, err := firecracker.NewMachine(ctx, firecracker.Config{
-		SocketPath:      "./firecracker.sock",
-		KernelImagePath: "./vmlinux-6.1",
-		KernelArgs:      "console=ttyS0 reboot=k panic=1 pci=off init=/my-custom-init",
-		Drives: []models.Drive{{
-			IsRootDevice: firecracker.Bool(true),
-			IsReadOnly:   firecracker.Bool(false),
-			PathOnHost:   firecracker.String("./rootfs.ext4"),
-			DriveID:      firecracker.String("rootfs"),
-		}},
-		MachineCfg: models.MachineConfiguration{
-			VcpuCount:  firecracker.Int64(2),
-			MemSizeMib: firecracker.Int64(1024),
-		},
-	})
-	if err != nil {
-		panic(err)
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == "snapshot":
+		runSnapshotCLI(os.Args[2:])
+		return
+	case len(os.Args) > 1 && os.Args[1] == "restore":
+		runRestoreCLI(os.Args[2:])
+		return
+	}
+	runDaemon()
+}
+
+// runDaemon starts the HTTP control plane; this is the default behavior
+// when no CLI subcommand is given.
+func runDaemon() {
+	addr := flag.String("addr", ":8080", "address for the VM manager HTTP API to listen on")
+	workDir := flag.String("work-dir", "./vms", "directory to store per-VM sockets, ISOs, and logs")
+	image := flag.String("image", "", "OCI image reference to build a rootfs from instead of requiring a prebuilt rootfs.ext4")
+	containerdSocket := flag.String("containerd-socket", "/run/containerd/containerd.sock", "containerd socket used when --image is set")
+	arch := flag.String("arch", "amd64", "guest architecture: amd64, arm64, or riscv64 — selects the matching kernel and init binary")
+	flag.Parse()
+
+	manager := newVMManager(*workDir)
+	manager.defaultKernelImagePath = kernelImagePathForArch(*arch)
+
+	if *image != "" {
+		rootfsPath, err := buildImageRootfs(context.Background(), *workDir, *image, *containerdSocket, *arch)
+		if err != nil {
+			log.Fatalf("build rootfs from image %s: %v", *image, err)
+		}
+		manager.defaultRootfsPath = rootfsPath
+		log.Printf("built rootfs for %s at %s", *image, rootfsPath)
 	}
 
-	if err := machine.Start(ctx); err != nil {
-		panic(err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vms", vmsHandler(manager))
+	mux.HandleFunc("/vms/", vmHandler(manager))
+
+	server := &http.Server{Addr: *addr, Handler: mux}
+
+	go func() {
+		log.Printf("listening on %s", *addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("http server: %v", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+
+	ctx := context.Background()
+	server.Shutdown(ctx)
+	manager.Shutdown(ctx)
+}
+
+// buildImageRootfs builds an ext4 rootfs from an OCI image reference,
+// registers it as the service named "main" so the guest init runs the
+// image's entrypoint, and bundles in the init binary cross-compiled for
+// arch so the result boots on non-amd64 hosts too.
+func buildImageRootfs(ctx context.Context, workDir string, image string, containerdSocket string, arch string) (string, error) {
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return "", err
 	}
 
-	<-make(chan os.Signal, 1)
+	return rootfsbuilder.Build(ctx, rootfsbuilder.Options{
+		ContainerdSocket: containerdSocket,
+		ImageRef:         image,
+		OutputPath:       filepath.Join(workDir, "image-rootfs.ext4"),
+		ServiceName:      "main",
+		InitBinaryPath:   initBinaryPathForArch(arch),
+	})
+}
+
+// kernelImagePathForArch returns the bundled kernel image for a given guest
+// architecture, following the "./vmlinux-<arch>" naming the tutorial's
+// README has guests download.
+func kernelImagePathForArch(arch string) string {
+	return fmt.Sprintf("./vmlinux-%s", arch)
+}
+
+// initBinaryPathForArch returns the init binary cross-compiled by
+// init/Makefile for a given guest architecture.
+func initBinaryPathForArch(arch string) string {
+	return fmt.Sprintf("./init/build/init-%s", arch)
+}
+
+// vmsHandler handles the collection endpoints: creating a VM and listing
+// every VM the daemon currently tracks.
+func vmsHandler(manager *vmManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var req createVMRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			info, err := manager.CreateVM(r.Context(), req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(info)
+
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(manager.List())
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// vmHandler handles every endpoint under /vms/{...}: deleting a VM by ID,
+// restoring one from a snapshot, and snapshotting an existing one.
+func vmHandler(manager *vmManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path[len("/vms/"):], "/")
+		if path == "" {
+			http.Error(w, "vm id is required", http.StatusBadRequest)
+			return
+		}
+		segments := strings.Split(path, "/")
+
+		if len(segments) == 1 && segments[0] == "restore" && r.Method == http.MethodPost {
+			var req restoreRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			result, err := manager.Restore(r.Context(), req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+
+		id := segments[0]
+
+		if len(segments) == 2 && segments[1] == "snapshot" && r.Method == http.MethodPost {
+			var req snapshotRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			result, err := manager.Snapshot(r.Context(), id, req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+
+		if len(segments) != 1 {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodDelete:
+			if err := manager.DeleteVM(r.Context(), id); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
 
-	if err := machine.Shutdown(ctx); err != nil {
-		panic(err)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
 	}
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"sync"
+)
+
+// networkAllocator hands out a tap device name and a /30 subnet for each VM.
+// Each VM gets its own point-to-point link: the host side holds the ".1"
+// address and the guest is configured (via cloud-init/kernel args) to use
+// ".2", mirroring the approach in the jvns firecracker gist.
+type networkAllocator struct {
+	mu   sync.Mutex
+	next byte
+	free []byte // indices freed by release(), reused before next is advanced
+}
+
+// allocation describes the network resources assigned to a single VM.
+type allocation struct {
+	Index     byte
+	TapDevice string
+	HostIP    net.IP
+	GuestIP   net.IP
+	Mask      net.IPMask
+}
+
+// allocate reserves an unused /30 subnet (172.16.<n>.0/30) and creates a tap
+// device for it. Indices freed by release are reused first, so a
+// long-running daemon cycling VMs doesn't exhaust the 256 available
+// subnets; only once the free list is empty does it advance the
+// high-water mark.
+func (a *networkAllocator) allocate() (*allocation, error) {
+	n := a.acquireIndex()
+
+	tap := fmt.Sprintf("tap%d", n)
+	if err := createTapDevice(tap); err != nil {
+		return nil, fmt.Errorf("create tap device %s: %w", tap, err)
+	}
+
+	hostIP := net.IPv4(172, 16, n, 1)
+	guestIP := net.IPv4(172, 16, n, 2)
+
+	if err := assignTapAddress(tap, hostIP); err != nil {
+		return nil, fmt.Errorf("assign address to %s: %w", tap, err)
+	}
+
+	return &allocation{
+		Index:     n,
+		TapDevice: tap,
+		HostIP:    hostIP,
+		GuestIP:   guestIP,
+		Mask:      net.CIDRMask(30, 32),
+	}, nil
+}
+
+// release removes a tap device and returns its subnet index to the free
+// list so a future allocate() can reuse it.
+func (a *networkAllocator) release(index byte, tap string) error {
+	err := exec.Command("ip", "link", "del", tap).Run()
+	a.freeIndex(index)
+	return err
+}
+
+// acquireIndex pops an unused subnet index, preferring one freed by a prior
+// release() over advancing the high-water mark, so a long-running daemon
+// cycling VMs doesn't exhaust the 256 available subnets.
+func (a *networkAllocator) acquireIndex() byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.free) > 0 {
+		n := a.free[len(a.free)-1]
+		a.free = a.free[:len(a.free)-1]
+		return n
+	}
+	n := a.next
+	a.next++
+	return n
+}
+
+// freeIndex returns a subnet index to the free list for acquireIndex to
+// reuse.
+func (a *networkAllocator) freeIndex(index byte) {
+	a.mu.Lock()
+	a.free = append(a.free, index)
+	a.mu.Unlock()
+}
+
+// createTapDevice creates and brings up a tap device using the `ip` CLI,
+// the same tool the jvns gist shells out to rather than pulling in netlink.
+func createTapDevice(name string) error {
+	if err := exec.Command("ip", "tuntap", "add", "dev", name, "mode", "tap").Run(); err != nil {
+		return err
+	}
+	return exec.Command("ip", "link", "set", name, "up").Run()
+}
+
+// assignTapAddress gives the host side of a tap device the ".1" address of
+// its /30.
+func assignTapAddress(name string, hostIP net.IP) error {
+	cidr := fmt.Sprintf("%s/30", hostIP.String())
+	return exec.Command("ip", "addr", "add", cidr, "dev", name).Run()
+}
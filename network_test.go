@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+// TestNetworkAllocatorReusesFreedIndices guards against acquireIndex
+// regressing to a bare monotonic counter: a daemon that churns through many
+// create/destroy cycles must not exhaust the 256 available subnets.
+func TestNetworkAllocatorReusesFreedIndices(t *testing.T) {
+	a := &networkAllocator{}
+
+	first := a.acquireIndex()
+	if first != 0 {
+		t.Fatalf("got index %d, want 0", first)
+	}
+
+	second := a.acquireIndex()
+	if second != 1 {
+		t.Fatalf("got index %d, want 1", second)
+	}
+
+	a.freeIndex(first)
+
+	third := a.acquireIndex()
+	if third != first {
+		t.Fatalf("expected freed index %d to be reused, got %d", first, third)
+	}
+
+	// The free list is now empty again, so the next allocation must advance
+	// the high-water mark rather than handing out an index still in use.
+	fourth := a.acquireIndex()
+	if fourth != 2 {
+		t.Fatalf("got index %d, want 2", fourth)
+	}
+}
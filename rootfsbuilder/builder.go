@@ -0,0 +1,86 @@
+// Package rootfsbuilder turns an OCI/Docker image reference into an ext4
+// rootfs image that can be handed straight to firecracker.Config.Drives,
+// so the tutorial's launcher doesn't require a prebuilt rootfs.ext4.
+package rootfsbuilder
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/namespaces"
+)
+
+const defaultNamespace = "firecracker-tutorial"
+
+// Options configures a single image-to-rootfs build.
+type Options struct {
+	// ContainerdSocket is the path to containerd's API socket.
+	ContainerdSocket string
+	// ImageRef is the OCI/Docker image reference to pull, e.g. "docker.io/library/alpine:3.19".
+	ImageRef string
+	// OutputPath is where the resulting ext4 image is written.
+	OutputPath string
+	// SizeMB is the size of the ext4 image to format before unpacking layers into it.
+	SizeMB int64
+	// ServiceName is the name the image's entrypoint is registered under in /etc/services.
+	ServiceName string
+	// InitBinaryPath, if set, is copied into the rootfs as /my-custom-init
+	// so the result boots standalone on the guest architecture it was
+	// cross-compiled for.
+	InitBinaryPath string
+}
+
+// Build pulls opts.ImageRef through containerd's content store, unpacks its
+// layers into a freshly formatted ext4 image, and writes a service spec
+// describing the image's entrypoint, env, and working directory so the
+// guest init knows how to run it.
+func Build(ctx context.Context, opts Options) (string, error) {
+	if opts.SizeMB == 0 {
+		opts.SizeMB = 512
+	}
+
+	client, err := containerd.New(opts.ContainerdSocket)
+	if err != nil {
+		return "", fmt.Errorf("connect to containerd: %w", err)
+	}
+	defer client.Close()
+
+	ctx = namespaces.WithNamespace(ctx, defaultNamespace)
+
+	image, err := client.Pull(ctx, opts.ImageRef)
+	if err != nil {
+		return "", fmt.Errorf("pull %s: %w", opts.ImageRef, err)
+	}
+
+	if err := createExt4Image(opts.OutputPath, opts.SizeMB); err != nil {
+		return "", fmt.Errorf("create ext4 image: %w", err)
+	}
+
+	mountDir, loopDev, err := mountLoopback(opts.OutputPath)
+	if err != nil {
+		return "", fmt.Errorf("mount %s: %w", opts.OutputPath, err)
+	}
+	defer unmountLoopback(mountDir, loopDev)
+
+	if err := unpackLayers(ctx, client, image, mountDir); err != nil {
+		return "", fmt.Errorf("unpack layers: %w", err)
+	}
+
+	cfg, err := imageConfig(ctx, image)
+	if err != nil {
+		return "", fmt.Errorf("read image config: %w", err)
+	}
+
+	if err := writeServiceSpec(mountDir, opts.ServiceName, cfg); err != nil {
+		return "", fmt.Errorf("write service spec: %w", err)
+	}
+
+	if opts.InitBinaryPath != "" {
+		if err := installInitBinary(mountDir, opts.InitBinaryPath); err != nil {
+			return "", fmt.Errorf("install init binary: %w", err)
+		}
+	}
+
+	return opts.OutputPath, nil
+}
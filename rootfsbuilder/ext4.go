@@ -0,0 +1,83 @@
+package rootfsbuilder
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// createExt4Image allocates a sparse file of sizeMB and formats it ext4,
+// mirroring what the tutorial previously expected the user to do by hand
+// to produce rootfs.ext4.
+func createExt4Image(path string, sizeMB int64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(sizeMB * 1024 * 1024); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return exec.Command("mkfs.ext4", "-F", path).Run()
+}
+
+// mountLoopback attaches path to a free loop device and mounts it under a
+// temporary directory, returning both so the caller can unpack layers into
+// it and unmount afterwards.
+func mountLoopback(path string) (mountDir string, loopDev string, err error) {
+	out, err := exec.Command("losetup", "--find", "--show", path).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("losetup: %w", err)
+	}
+	loopDev = strings.TrimSpace(string(out))
+
+	mountDir, err = os.MkdirTemp("", "rootfsbuilder-")
+	if err != nil {
+		exec.Command("losetup", "-d", loopDev).Run()
+		return "", "", err
+	}
+
+	if err := exec.Command("mount", loopDev, mountDir).Run(); err != nil {
+		exec.Command("losetup", "-d", loopDev).Run()
+		os.RemoveAll(mountDir)
+		return "", "", fmt.Errorf("mount %s: %w", loopDev, err)
+	}
+
+	return mountDir, loopDev, nil
+}
+
+// installInitBinary copies the cross-compiled init binary for the target
+// guest architecture into the rootfs at /my-custom-init, matching the
+// init= kernel argument the launcher boots with.
+func installInitBinary(mountDir string, initBinaryPath string) error {
+	src, err := os.Open(initBinaryPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dstPath := filepath.Join(mountDir, "my-custom-init")
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// unmountLoopback undoes mountLoopback, best-effort, logging nothing since
+// callers already have the original error if the build failed.
+func unmountLoopback(mountDir string, loopDev string) {
+	exec.Command("umount", mountDir).Run()
+	os.RemoveAll(mountDir)
+	exec.Command("losetup", "-d", loopDev).Run()
+}
@@ -0,0 +1,75 @@
+package rootfsbuilder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/archive"
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// unpackLayers walks the image's manifest in order and applies each layer's
+// tar stream directly onto mountDir, the mounted ext4 image.
+func unpackLayers(ctx context.Context, client *containerd.Client, image containerd.Image, mountDir string) error {
+	store := client.ContentStore()
+
+	manifest, err := images.Manifest(ctx, store, image.Target(), platforms.Default())
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	for _, layer := range manifest.Layers {
+		ra, err := store.ReaderAt(ctx, layer)
+		if err != nil {
+			return fmt.Errorf("open layer %s: %w", layer.Digest, err)
+		}
+
+		// client.Pull is called without WithPullUnpack, so the content store
+		// holds each layer's original bytes under its manifest digest -
+		// gzip-compressed for essentially every real-world image. Decompress
+		// before handing it to archive.Apply, which expects a bare tar
+		// stream, the same way containerd's own diff/unpack path does.
+		decompressed, err := compression.DecompressStream(content.NewReader(ra))
+		if err != nil {
+			ra.Close()
+			return fmt.Errorf("decompress layer %s: %w", layer.Digest, err)
+		}
+
+		if _, err := archive.Apply(ctx, mountDir, decompressed); err != nil {
+			decompressed.Close()
+			ra.Close()
+			return fmt.Errorf("apply layer %s: %w", layer.Digest, err)
+		}
+		decompressed.Close()
+		ra.Close()
+	}
+
+	return nil
+}
+
+// imageConfig fetches and decodes the image's OCI config, which carries the
+// Entrypoint, Cmd, Env, WorkingDir, and User we need to run it.
+func imageConfig(ctx context.Context, image containerd.Image) (ocispec.ImageConfig, error) {
+	desc, err := image.Config(ctx)
+	if err != nil {
+		return ocispec.ImageConfig{}, fmt.Errorf("read config descriptor: %w", err)
+	}
+
+	b, err := content.ReadBlob(ctx, image.ContentStore(), desc)
+	if err != nil {
+		return ocispec.ImageConfig{}, fmt.Errorf("read config blob: %w", err)
+	}
+
+	var spec ocispec.Image
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return ocispec.ImageConfig{}, fmt.Errorf("decode config: %w", err)
+	}
+
+	return spec.Config, nil
+}
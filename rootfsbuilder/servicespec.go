@@ -0,0 +1,55 @@
+package rootfsbuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ServiceSpec is the per-service description written to
+// /etc/services/<name>.service. It's how a rootfs built from an OCI
+// image tells the guest init what to exec, since the image's entrypoint
+// binary is rarely something init can just run bare.
+type ServiceSpec struct {
+	Name string   `json:"name"`
+	Path string   `json:"path"`
+	Args []string `json:"args,omitempty"`
+	Env  []string `json:"env,omitempty"`
+	Cwd  string   `json:"cwd,omitempty"`
+	User string   `json:"user,omitempty"`
+}
+
+// writeServiceSpec derives a ServiceSpec from the image's Entrypoint, Cmd,
+// Env, WorkingDir and User, and writes it under mountDir/etc/services so
+// the guest init can find it at boot.
+func writeServiceSpec(mountDir string, name string, cfg ocispec.ImageConfig) error {
+	servicesDir := filepath.Join(mountDir, "etc", "services")
+	if err := os.MkdirAll(servicesDir, 0755); err != nil {
+		return err
+	}
+
+	argv := append(append([]string{}, cfg.Entrypoint...), cfg.Cmd...)
+	if len(argv) == 0 {
+		return fmt.Errorf("image has neither Entrypoint nor Cmd, nothing to run")
+	}
+
+	spec := ServiceSpec{
+		Name: name,
+		Path: argv[0],
+		Args: argv[1:],
+		Env:  cfg.Env,
+		Cwd:  cfg.WorkingDir,
+		User: cfg.User,
+	}
+
+	b, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	specPath := filepath.Join(servicesDir, name+".service")
+	return os.WriteFile(specPath, b, 0644)
+}
@@ -0,0 +1,86 @@
+package rootfsbuilder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// TestWriteServiceSpec covers the pure argv-assembly logic writeServiceSpec
+// derives from an image's Entrypoint/Cmd, without touching containerd.
+func TestWriteServiceSpec(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfg      ocispec.ImageConfig
+		wantPath string
+		wantArgs []string
+	}{
+		{
+			name:     "entrypoint only",
+			cfg:      ocispec.ImageConfig{Entrypoint: []string{"/bin/myapp", "--flag"}},
+			wantPath: "/bin/myapp",
+			wantArgs: []string{"--flag"},
+		},
+		{
+			name:     "cmd only",
+			cfg:      ocispec.ImageConfig{Cmd: []string{"nginx", "-g", "daemon off;"}},
+			wantPath: "nginx",
+			wantArgs: []string{"-g", "daemon off;"},
+		},
+		{
+			name:     "entrypoint and cmd concatenated",
+			cfg:      ocispec.ImageConfig{Entrypoint: []string{"/entrypoint.sh"}, Cmd: []string{"serve"}},
+			wantPath: "/entrypoint.sh",
+			wantArgs: []string{"serve"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mountDir := t.TempDir()
+
+			if err := writeServiceSpec(mountDir, "web", c.cfg); err != nil {
+				t.Fatalf("writeServiceSpec: %v", err)
+			}
+
+			b, err := os.ReadFile(filepath.Join(mountDir, "etc", "services", "web.service"))
+			if err != nil {
+				t.Fatalf("read service spec: %v", err)
+			}
+
+			var got ServiceSpec
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("unmarshal service spec: %v", err)
+			}
+
+			if got.Name != "web" {
+				t.Errorf("Name = %q, want %q", got.Name, "web")
+			}
+			if got.Path != c.wantPath {
+				t.Errorf("Path = %q, want %q", got.Path, c.wantPath)
+			}
+			if len(got.Args) != len(c.wantArgs) {
+				t.Fatalf("Args = %v, want %v", got.Args, c.wantArgs)
+			}
+			for i, arg := range c.wantArgs {
+				if got.Args[i] != arg {
+					t.Errorf("Args[%d] = %q, want %q", i, got.Args[i], arg)
+				}
+			}
+		})
+	}
+}
+
+// TestWriteServiceSpecNeitherSet covers the error path when the image
+// declares neither an Entrypoint nor a Cmd, so there's nothing to run.
+func TestWriteServiceSpecNeitherSet(t *testing.T) {
+	mountDir := t.TempDir()
+
+	err := writeServiceSpec(mountDir, "web", ocispec.ImageConfig{})
+	if err == nil {
+		t.Fatal("writeServiceSpec() = nil error, want error for image with no Entrypoint/Cmd")
+	}
+}
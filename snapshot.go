@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+// snapshotRequest is the body of POST /vms/{id}/snapshot.
+type snapshotRequest struct {
+	// Dir is where mem_file and snapshot_file are written.
+	Dir string `json:"dir"`
+	// Exit stops the VM after snapshotting instead of resuming it.
+	Exit bool `json:"exit"`
+}
+
+// snapshotResult is the response to a successful snapshot request.
+type snapshotResult struct {
+	ID           string `json:"id"`
+	MemFilePath  string `json:"mem_file_path"`
+	SnapshotPath string `json:"snapshot_path"`
+}
+
+// Snapshot pauses a running VM, writes its memory and device state to
+// req.Dir, and either resumes it or tears it down depending on req.Exit.
+func (m *vmManager) Snapshot(ctx context.Context, id string, req snapshotRequest) (*snapshotResult, error) {
+	if req.Dir == "" {
+		return nil, fmt.Errorf("dir is required")
+	}
+
+	m.mu.Lock()
+	info, ok := m.vms[id]
+	m.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("vm %s not found", id)
+	}
+
+	if err := os.MkdirAll(req.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	memFilePath := filepath.Join(req.Dir, "mem_file")
+	snapshotPath := filepath.Join(req.Dir, "snapshot_file")
+
+	if err := info.machine.PauseVM(ctx); err != nil {
+		return nil, fmt.Errorf("pause vm: %w", err)
+	}
+
+	if err := info.machine.CreateSnapshot(ctx, memFilePath, snapshotPath); err != nil {
+		return nil, fmt.Errorf("create snapshot: %w", err)
+	}
+
+	if req.Exit {
+		if err := m.DeleteVM(ctx, id); err != nil {
+			return nil, fmt.Errorf("stop vm after snapshot: %w", err)
+		}
+	} else if err := info.machine.ResumeVM(ctx); err != nil {
+		return nil, fmt.Errorf("resume vm: %w", err)
+	}
+
+	return &snapshotResult{ID: id, MemFilePath: memFilePath, SnapshotPath: snapshotPath}, nil
+}
+
+// restoreRequest is the body of POST /vms/restore.
+type restoreRequest struct {
+	// Dir holds the mem_file and snapshot_file written by a prior Snapshot call.
+	Dir string `json:"dir"`
+}
+
+// restoreResult is the response to a successful restore request: the usual
+// vmInfo plus how long Start took to bring the snapshot back up, since
+// restore latency is the whole point of snapshotting.
+type restoreResult struct {
+	*vmInfo
+	RestoreLatencyMS int64 `json:"restore_latency_ms"`
+}
+
+// Restore brings up a new VM from a snapshot directory written by
+// Snapshot, skipping kernel and drive setup entirely since that state is
+// already captured in the snapshot.
+func (m *vmManager) Restore(ctx context.Context, req restoreRequest) (*restoreResult, error) {
+	if req.Dir == "" {
+		return nil, fmt.Errorf("dir is required")
+	}
+	memFilePath := filepath.Join(req.Dir, "mem_file")
+	snapshotPath := filepath.Join(req.Dir, "snapshot_file")
+
+	id := fmt.Sprintf("vm-%d", atomic.AddUint64(&m.nextID, 1))
+	vmDir := filepath.Join(m.workDir, id)
+	if err := os.MkdirAll(vmDir, 0755); err != nil {
+		return nil, err
+	}
+
+	alloc, err := m.network.allocate()
+	if err != nil {
+		return nil, err
+	}
+
+	vsockUDSPath := filepath.Join(vmDir, "vsock.sock")
+	logDir := filepath.Join(vmDir, "logs")
+	logCollector, err := startLogCollector(vsockUDSPath, defaultVsockLogPort, logDir)
+	if err != nil {
+		m.network.release(alloc.Index, alloc.TapDevice)
+		return nil, fmt.Errorf("start log collector: %w", err)
+	}
+
+	cfg := firecracker.Config{
+		SocketPath: filepath.Join(vmDir, "firecracker.sock"),
+		VsockDevices: []firecracker.VsockDevice{{
+			Path: vsockUDSPath,
+			CID:  3,
+		}},
+		NetworkInterfaces: []firecracker.NetworkInterface{{
+			StaticConfiguration: &firecracker.StaticNetworkConfiguration{
+				HostDevName: alloc.TapDevice,
+				IPConfiguration: &firecracker.IPConfiguration{
+					IPAddr:  net.IPNet{IP: alloc.GuestIP, Mask: alloc.Mask},
+					Gateway: alloc.HostIP,
+				},
+			},
+		}},
+	}
+
+	// WithSnapshot is what actually swaps the SDK's validation and init
+	// handler lists to the load-snapshot path; setting cfg.Snapshot alone
+	// doesn't — Start would otherwise validate KernelImagePath and boot
+	// normally instead of restoring.
+	machine, err := firecracker.NewMachine(ctx, cfg, firecracker.WithSnapshot(memFilePath, snapshotPath))
+	if err != nil {
+		logCollector.Close()
+		m.network.release(alloc.Index, alloc.TapDevice)
+		return nil, fmt.Errorf("new machine: %w", err)
+	}
+
+	started := time.Now()
+	if err := machine.Start(ctx); err != nil {
+		logCollector.Close()
+		m.network.release(alloc.Index, alloc.TapDevice)
+		return nil, fmt.Errorf("start machine from snapshot: %w", err)
+	}
+	latency := time.Since(started)
+
+	info := &vmInfo{
+		ID:           id,
+		IP:           alloc.GuestIP.String(),
+		machine:      machine,
+		tap:          alloc.TapDevice,
+		tapIndex:     alloc.Index,
+		workDir:      vmDir,
+		logCollector: logCollector,
+	}
+
+	m.mu.Lock()
+	m.vms[id] = info
+	m.mu.Unlock()
+
+	return &restoreResult{vmInfo: info, RestoreLatencyMS: latency.Milliseconds()}, nil
+}
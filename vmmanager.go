@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/firecracker-microvm/firecracker-go-sdk"
+	"github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+// createVMRequest is the body of POST /vms.
+type createVMRequest struct {
+	KernelImagePath string `json:"kernel_image_path"`
+	RootfsPath      string `json:"rootfs_path"`
+	VCPUCount       int64  `json:"vcpu_count"`
+	MemSizeMib      int64  `json:"mem_size_mib"`
+}
+
+// vmInfo is what we hand back to API callers and keep around for teardown.
+type vmInfo struct {
+	ID       string `json:"id"`
+	IP       string `json:"ip"`
+	machine  *firecracker.Machine
+	tap      string
+	tapIndex byte
+	workDir  string
+	// logCollector stops the vsock log collector's accept loop; it must be
+	// closed during teardown or the listener goroutine leaks.
+	logCollector io.Closer
+}
+
+// vmManager tracks every microVM the daemon has started, keyed by an
+// allocated ID, so that HTTP handlers can create, list, and tear them down.
+type vmManager struct {
+	mu      sync.Mutex
+	vms     map[string]*vmInfo
+	nextID  uint64
+	network networkAllocator
+	workDir string
+
+	// defaultRootfsPath is used for create requests that don't specify a
+	// rootfs, set when the daemon was started with --image.
+	defaultRootfsPath string
+	// defaultKernelImagePath is used for create requests that don't
+	// specify a kernel image, set from the daemon's --arch flag.
+	defaultKernelImagePath string
+}
+
+func newVMManager(workDir string) *vmManager {
+	return &vmManager{
+		vms:     make(map[string]*vmInfo),
+		workDir: workDir,
+	}
+}
+
+// applyVMDefaults fills in whatever the caller left zero on a createVMRequest,
+// falling back to the daemon's --image/--arch defaults for the image paths,
+// and fails if no kernel or rootfs is available from either source.
+func applyVMDefaults(req createVMRequest, defaultKernelImagePath, defaultRootfsPath string) (createVMRequest, error) {
+	if req.KernelImagePath == "" {
+		req.KernelImagePath = defaultKernelImagePath
+	}
+	if req.KernelImagePath == "" {
+		return createVMRequest{}, fmt.Errorf("kernel_image_path is required")
+	}
+	if req.RootfsPath == "" {
+		req.RootfsPath = defaultRootfsPath
+	}
+	if req.RootfsPath == "" {
+		return createVMRequest{}, fmt.Errorf("rootfs_path is required")
+	}
+	if req.VCPUCount == 0 {
+		req.VCPUCount = 2
+	}
+	if req.MemSizeMib == 0 {
+		req.MemSizeMib = 1024
+	}
+	return req, nil
+}
+
+// CreateVM allocates network resources, mints a cloud-init ISO, and starts a
+// new Firecracker microVM, applying defaults for anything the caller left
+// zero.
+func (m *vmManager) CreateVM(ctx context.Context, req createVMRequest) (info *vmInfo, err error) {
+	req, err = applyVMDefaults(req, m.defaultKernelImagePath, m.defaultRootfsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	id := fmt.Sprintf("vm-%d", atomic.AddUint64(&m.nextID, 1))
+	vmDir := filepath.Join(m.workDir, id)
+	if err := os.MkdirAll(vmDir, 0755); err != nil {
+		return nil, err
+	}
+	// Every error return below leaves vmDir untracked in m.vms, so teardown
+	// would never get a chance to clean it up; remove it ourselves unless
+	// we make it all the way to a tracked, running VM.
+	defer func() {
+		if err != nil {
+			os.RemoveAll(vmDir)
+		}
+	}()
+
+	alloc, err := m.network.allocate()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			m.network.release(alloc.Index, alloc.TapDevice)
+		}
+	}()
+
+	isoPath, err := writeCloudInitISO(vmDir, id, alloc)
+	if err != nil {
+		return nil, err
+	}
+
+	vsockUDSPath := filepath.Join(vmDir, "vsock.sock")
+	logDir := filepath.Join(vmDir, "logs")
+	logCollector, err := startLogCollector(vsockUDSPath, defaultVsockLogPort, logDir)
+	if err != nil {
+		return nil, fmt.Errorf("start log collector: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			logCollector.Close()
+		}
+	}()
+
+	cfg := firecracker.Config{
+		SocketPath:      filepath.Join(vmDir, "firecracker.sock"),
+		KernelImagePath: req.KernelImagePath,
+		KernelArgs:      "console=ttyS0 reboot=k panic=1 pci=off init=/my-custom-init",
+		Drives: []models.Drive{
+			{
+				IsRootDevice: firecracker.Bool(true),
+				IsReadOnly:   firecracker.Bool(false),
+				PathOnHost:   firecracker.String(req.RootfsPath),
+				DriveID:      firecracker.String("rootfs"),
+			},
+			{
+				IsRootDevice: firecracker.Bool(false),
+				IsReadOnly:   firecracker.Bool(true),
+				PathOnHost:   firecracker.String(isoPath),
+				DriveID:      firecracker.String("cloudinit"),
+			},
+		},
+		VsockDevices: []firecracker.VsockDevice{{
+			Path: vsockUDSPath,
+			CID:  3,
+		}},
+		NetworkInterfaces: []firecracker.NetworkInterface{{
+			StaticConfiguration: &firecracker.StaticNetworkConfiguration{
+				HostDevName: alloc.TapDevice,
+				IPConfiguration: &firecracker.IPConfiguration{
+					IPAddr:  net.IPNet{IP: alloc.GuestIP, Mask: alloc.Mask},
+					Gateway: alloc.HostIP,
+				},
+			},
+		}},
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:  firecracker.Int64(req.VCPUCount),
+			MemSizeMib: firecracker.Int64(req.MemSizeMib),
+		},
+	}
+
+	machine, err := firecracker.NewMachine(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new machine: %w", err)
+	}
+
+	if err = machine.Start(ctx); err != nil {
+		return nil, fmt.Errorf("start machine: %w", err)
+	}
+
+	info = &vmInfo{
+		ID:           id,
+		IP:           alloc.GuestIP.String(),
+		machine:      machine,
+		tap:          alloc.TapDevice,
+		tapIndex:     alloc.Index,
+		workDir:      vmDir,
+		logCollector: logCollector,
+	}
+
+	m.mu.Lock()
+	m.vms[id] = info
+	m.mu.Unlock()
+
+	return info, nil
+}
+
+// DeleteVM stops a VM's VMM and cleans up the tap device and per-VM
+// artifacts it was using.
+func (m *vmManager) DeleteVM(ctx context.Context, id string) error {
+	m.mu.Lock()
+	info, ok := m.vms[id]
+	if ok {
+		delete(m.vms, id)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("vm %s not found", id)
+	}
+
+	return m.teardown(ctx, info)
+}
+
+// teardown releases every resource a VM holds, continuing even if StopVMM
+// fails so a dead firecracker process doesn't leak the tap device, log
+// collector goroutine, or per-VM directory with no way to retry.
+func (m *vmManager) teardown(ctx context.Context, info *vmInfo) error {
+	stopErr := info.machine.StopVMM()
+
+	if info.logCollector != nil {
+		info.logCollector.Close()
+	}
+	m.network.release(info.tapIndex, info.tap)
+	removeErr := os.RemoveAll(info.workDir)
+
+	return errors.Join(stopErr, removeErr)
+}
+
+// List returns a snapshot of every VM currently tracked.
+func (m *vmManager) List() []*vmInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]*vmInfo, 0, len(m.vms))
+	for _, info := range m.vms {
+		out = append(out, info)
+	}
+	return out
+}
+
+// Shutdown tears down every tracked VM, used when the daemon itself is
+// exiting.
+func (m *vmManager) Shutdown(ctx context.Context) {
+	m.mu.Lock()
+	vms := make([]*vmInfo, 0, len(m.vms))
+	for _, info := range m.vms {
+		vms = append(vms, info)
+	}
+	m.vms = make(map[string]*vmInfo)
+	m.mu.Unlock()
+
+	for _, info := range vms {
+		if err := m.teardown(ctx, info); err != nil {
+			fmt.Printf("failed to tear down %s: %v\n", info.ID, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestApplyVMDefaults(t *testing.T) {
+	req, err := applyVMDefaults(createVMRequest{}, "vmlinux-amd64", "rootfs.ext4")
+	if err != nil {
+		t.Fatalf("applyVMDefaults: %v", err)
+	}
+	if req.KernelImagePath != "vmlinux-amd64" {
+		t.Errorf("KernelImagePath = %q, want %q", req.KernelImagePath, "vmlinux-amd64")
+	}
+	if req.RootfsPath != "rootfs.ext4" {
+		t.Errorf("RootfsPath = %q, want %q", req.RootfsPath, "rootfs.ext4")
+	}
+	if req.VCPUCount != 2 {
+		t.Errorf("VCPUCount = %d, want 2", req.VCPUCount)
+	}
+	if req.MemSizeMib != 1024 {
+		t.Errorf("MemSizeMib = %d, want 1024", req.MemSizeMib)
+	}
+
+	explicit := createVMRequest{
+		KernelImagePath: "custom-kernel",
+		RootfsPath:      "custom-rootfs.ext4",
+		VCPUCount:       4,
+		MemSizeMib:      2048,
+	}
+	got, err := applyVMDefaults(explicit, "vmlinux-amd64", "rootfs.ext4")
+	if err != nil {
+		t.Fatalf("applyVMDefaults: %v", err)
+	}
+	if got != explicit {
+		t.Errorf("applyVMDefaults overrode an explicit request: got %+v, want %+v", got, explicit)
+	}
+
+	if _, err := applyVMDefaults(createVMRequest{}, "", "rootfs.ext4"); err == nil {
+		t.Error("expected error when no kernel image path is available")
+	}
+	if _, err := applyVMDefaults(createVMRequest{}, "vmlinux-amd64", ""); err == nil {
+		t.Error("expected error when no rootfs path is available")
+	}
+}